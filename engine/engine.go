@@ -3,6 +3,7 @@ package engine
 import (
 	"context"
 	"runtime"
+	"sync/atomic"
 
 	. "github.com/ChizhovVadim/CounterGo/common"
 )
@@ -10,15 +11,17 @@ import (
 type Engine struct {
 	Hash               IntUciOption
 	Threads            IntUciOption
+	MultiPV            IntUciOption
 	ExperimentSettings bool
-	timeManager        timeManager
+	timeManager        atomic.Pointer[timeManager] // set by Search; PonderHit/Stop may race a not-yet-started search
 	transTable         TransTable
 	lateMoveReduction  func(d, m int) int
 	historyKeys        map[uint64]int
-	done               <-chan struct{}
+	stopHelpers        chan struct{}
+	globalDepth        int32 // highest depth the main thread is currently searching; read/written with atomic ops
 	threads            []thread
 	progress           func(SearchInfo)
-	mainLine           mainLine
+	mainLines          []mainLine // indexed by PV rank, best (rank 0) first
 }
 
 type thread struct {
@@ -56,6 +59,9 @@ type SortTable interface {
 	NoteQS(p *Position, ml []OrderedMove)
 }
 
+// TransTable must be safe for concurrent Read/Update from every
+// Lazy-SMP thread without external locking (e.g. a lockless Hyatt
+// XOR-of-key-and-data slot scheme).
 type TransTable interface {
 	Megabytes() int
 	PrepareNewSearch()
@@ -69,6 +75,7 @@ func NewEngine() *Engine {
 	return &Engine{
 		Hash:               IntUciOption{Name: "Hash", Value: 4, Min: 4, Max: 512},
 		Threads:            IntUciOption{Name: "Threads", Value: 1, Min: 1, Max: numCPUs},
+		MultiPV:            IntUciOption{Name: "MultiPV", Value: 1, Min: 1, Max: 8},
 		ExperimentSettings: false,
 	}
 }
@@ -78,7 +85,7 @@ func (e *Engine) GetInfo() (name, version, author string) {
 }
 
 func (e *Engine) GetOptions() []UciOption {
-	return []UciOption{&e.Hash, &e.Threads}
+	return []UciOption{&e.Hash, &e.Threads, &e.MultiPV}
 }
 
 func (e *Engine) Prepare() {
@@ -97,30 +104,64 @@ func (e *Engine) Prepare() {
 			t.evaluator = NewEvaluationService()
 		}
 	}
+	if len(e.mainLines) != e.MultiPV.Value {
+		e.mainLines = make([]mainLine, e.MultiPV.Value)
+	}
 }
 
+// Search runs a search to completion and returns the best line found.
+// Callers that want to ponder invoke it as `go engine.Search(ctx, params)`
+// with searchParams.Ponder set, then later call PonderHit (the opponent
+// played the expected move, engage normal time controls) or Stop (give
+// up pondering now and return the current best line).
+//
+// There is no PonderMove parameter: engine has no way to verify the
+// opponent's actual reply against a predicted one, so that decision is
+// the caller's (UCI "ponderhit" vs. a fresh "position"+"go").
 func (e *Engine) Search(ctx context.Context, searchParams SearchParams) SearchInfo {
 	var p = &searchParams.Positions[len(searchParams.Positions)-1]
-	e.timeManager = NewTimeManager(searchParams.Limits, timeControlSmart, p.WhiteMove)
-	if e.timeManager.hardTime > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, e.timeManager.hardTime)
-		defer cancel()
-	}
+	var tm = NewTimeManager(searchParams.Limits, timeControlSmart,
+		p.WhiteMove, searchParams.Ponder, ctx)
+	e.timeManager.Store(tm)
+	defer tm.Close()
+
 	e.Prepare()
 	e.transTable.PrepareNewSearch()
 	e.historyKeys = getHistoryKeys(searchParams.Positions)
-	e.done = ctx.Done()
 	for i := range e.threads {
 		var t = &e.threads[i]
 		t.nodes = 0
 		t.stack[0].position = *p
 	}
+	for i := range e.mainLines {
+		e.mainLines[i] = mainLine{}
+	}
 	e.progress = searchParams.Progress
 	e.iterativeDeepening()
 	return e.currentSearchResult()
 }
 
+// PonderHit tells an in-progress ponder search that the opponent played
+// the expected move: the clock resets to now and normal time controls
+// engage. It has no effect if the current search isn't pondering.
+func (e *Engine) PonderHit() {
+	if tm := e.timeManager.Load(); tm != nil {
+		tm.PonderHit()
+	}
+}
+
+// Stop cancels the in-progress search (pondering or not); Search returns
+// with the current best line shortly after.
+func (e *Engine) Stop() {
+	if tm := e.timeManager.Load(); tm != nil {
+		tm.Stop()
+	}
+}
+
+func (e *Engine) doneChan() <-chan struct{} {
+	return e.timeManager.Load().Done()
+}
+
 func (e *Engine) nodes() int64 {
 	var result = 0
 	for i := range e.threads {
@@ -157,19 +198,34 @@ func (ml *mainLine) update(depth, score int, mainLine []Move) {
 	ml.moves = mainLine
 }
 
+// currentSearchResult returns the primary (best) PV, which is what
+// callers outside the UCI MultiPV loop expect from Search.
 func (e *Engine) currentSearchResult() SearchInfo {
+	return e.searchResult(0)
+}
+
+func (e *Engine) searchResult(pvIndex int) SearchInfo {
+	var ml = &e.mainLines[pvIndex]
 	return SearchInfo{
-		Depth:    e.mainLine.depth,
-		MainLine: e.mainLine.moves,
-		Score:    newUciScore(e.mainLine.score),
+		Depth:    ml.depth,
+		MainLine: ml.moves,
+		Score:    newUciScore(ml.score),
 		Nodes:    e.nodes(),
-		Time:     e.timeManager.ElapsedMilliseconds(),
+		Time:     e.timeManager.Load().ElapsedMilliseconds(),
 	}
 }
 
+// sendProgress reports every PV rank that has found a move this depth,
+// best first, so a MultiPV > 1 search surfaces one progress line per PV.
 func (e *Engine) sendProgress() {
-	if e.progress != nil {
-		e.progress(e.currentSearchResult())
+	if e.progress == nil {
+		return
+	}
+	for i := range e.mainLines {
+		if e.mainLines[i].moves == nil {
+			break
+		}
+		e.progress(e.searchResult(i))
 	}
 }
 
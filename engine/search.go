@@ -2,94 +2,239 @@ package engine
 
 import (
 	"errors"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 
 	. "github.com/ChizhovVadim/CounterGo/common"
 )
 
 var searchTimeout = errors.New("search timeout")
 
+// iterativeDeepening runs Lazy-SMP: the main thread drives PV reporting
+// and time management while every other thread searches ml independently
+// in lazySmpHelper, sharing only the transposition table and globalDepth.
 func (e *Engine) iterativeDeepening() {
 	defer recoverFromSearchTimeout()
 
 	var ml = e.genRootMoves()
 	if len(ml) != 0 {
-		e.mainLine.update(0, 0, []Move{ml[0]})
+		e.mainLines[0].update(0, 0, []Move{ml[0]})
 	}
 	if len(ml) <= 1 {
 		return
 	}
 
+	e.stopHelpers = make(chan struct{})
+	var wg = &sync.WaitGroup{}
+	for i := 1; i < len(e.threads); i++ {
+		wg.Add(1)
+		var helperML = append([]Move(nil), ml...)
+		go func(threadIndex int, ml []Move) {
+			defer wg.Done()
+			defer recoverFromSearchTimeout()
+			e.threads[threadIndex].lazySmpHelper(threadIndex, ml)
+		}(i, helperML)
+	}
+	// Runs on every exit path, including the panic-driven hard-timeout
+	// path caught by the recoverFromSearchTimeout above, so helpers are
+	// always joined before Search resets thread state for the next call.
+	defer func() {
+		close(e.stopHelpers)
+		wg.Wait()
+	}()
+
 	var prevScore int
 	for depth := 1; depth <= maxHeight; depth++ {
-		e.searchRootParallel(ml, depth)
-		if isDone(e.done) {
+		atomic.StoreInt32(&e.globalDepth, int32(depth))
+		e.searchRootMain(ml, depth)
+		if isDone(e.doneChan()) {
 			break
 		}
-		if e.mainLine.score >= winIn(depth-3) ||
-			e.mainLine.score <= lossIn(depth-3) {
+		var bestScore = e.mainLines[0].score
+		if bestScore >= winIn(depth-3) ||
+			bestScore <= lossIn(depth-3) {
 			break
 		}
-		if AbsDelta(prevScore, e.mainLine.score) <= PawnValue/2 &&
-			e.timeManager.IsSoftTimeout() {
+		if AbsDelta(prevScore, bestScore) <= PawnValue/2 &&
+			e.timeManager.Load().IsSoftTimeout() {
 			break
 		}
-		prevScore = e.mainLine.score
+		prevScore = bestScore
 		e.sendProgress()
 	}
 }
 
-func (e *Engine) searchRootParallel(ml []Move, depth int) int {
-	var mainThread = &e.threads[0]
+// searchRootMain finds the MultiPV.Value best distinct root moves at
+// depth by excluding each rank's move from the next rank's search.
+func (e *Engine) searchRootMain(ml []Move, depth int) {
+	var multiPV = min(max(e.MultiPV.Value, 1), len(ml))
+	var excluded = make([]Move, 0, multiPV)
+	for pvIndex := 0; pvIndex < multiPV; pvIndex++ {
+		var bestMove, score, pvMoves = e.searchRootPV(ml, excluded, depth, pvIndex)
+		if bestMove == MoveEmpty {
+			break
+		}
+		e.mainLines[pvIndex].update(depth, score, pvMoves)
+		excluded = append(excluded, bestMove)
+	}
+	if len(excluded) != 0 {
+		moveToBegin(ml, indexOfMove(ml, excluded[0]))
+	}
+}
+
+// searchRootPV widens an aspiration window around pvIndex's previous
+// score on fail-high/fail-low until the score lands inside it.
+func (e *Engine) searchRootPV(ml []Move, excluded []Move, depth, pvIndex int) (Move, int, []Move) {
+	var alpha, beta = -valueInfinity, valueInfinity
+	var delta = PawnValue / 4
+	if depth > 4 && e.mainLines[pvIndex].moves != nil {
+		var prevScore = e.mainLines[pvIndex].score
+		alpha = max(-valueInfinity, prevScore-delta)
+		beta = min(valueInfinity, prevScore+delta)
+	}
+
+	for {
+		var score, bestMove, pvMoves, anyLegalMove = e.searchRootWindow(ml, excluded, depth, alpha, beta)
+		if !anyLegalMove {
+			return MoveEmpty, 0, nil
+		}
+		if score <= alpha {
+			beta = (alpha + beta) / 2
+			alpha = max(-valueInfinity, alpha-delta)
+			delta *= 2
+			continue
+		}
+		if score >= beta {
+			beta = min(valueInfinity, beta+delta)
+			delta *= 2
+			continue
+		}
+		return bestMove, score, pvMoves
+	}
+}
+
+// searchRootWindow runs a single PVS pass over ml within [alpha, beta],
+// skipping excluded moves. anyLegalMove is false only when ml has no
+// legal move left to try; bestMove stays MoveEmpty on a plain fail-low
+// even when anyLegalMove is true, so callers must check anyLegalMove
+// first.
+func (e *Engine) searchRootWindow(ml []Move, excluded []Move, depth, alpha, beta int) (score int, bestMove Move, pvMoves []Move, anyLegalMove bool) {
+	var t = &e.threads[0]
+	const height = 0
+	var p = &t.stack[height].position
+	score = alpha
+	for _, move := range ml {
+		if containsMove(excluded, move) {
+			continue
+		}
+		var child = &t.stack[height+1].position
+		if !p.MakeMove(move, child) {
+			continue
+		}
+		var newDepth = t.newDepth(depth, height)
+		var s int
+		if !anyLegalMove {
+			s = -t.alphaBeta(-beta, -score, newDepth, height+1)
+		} else {
+			s = -t.alphaBeta(-(score + 1), -score, newDepth, height+1)
+			if s > score && s < beta {
+				s = -t.alphaBeta(-beta, -score, newDepth, height+1)
+			}
+		}
+		anyLegalMove = true
+		if s > score {
+			score = s
+			bestMove = move
+			pvMoves = append([]Move{move}, t.stack[height+1].pv.moves()...)
+			if score >= beta {
+				break
+			}
+		}
+	}
+	return
+}
+
+func containsMove(moves []Move, m Move) bool {
+	for _, x := range moves {
+		if x == m {
+			return true
+		}
+	}
+	return false
+}
+
+func indexOfMove(ml []Move, m Move) int {
+	for i, x := range ml {
+		if x == m {
+			return i
+		}
+	}
+	return 0
+}
+
+// lazySmpHelper searches ml independently until the main thread stops,
+// staggering its depth and move order away from the main thread's.
+func (t *thread) lazySmpHelper(threadIndex int, ml []Move) {
+	var rnd = rand.New(rand.NewSource(int64(threadIndex)))
+	for {
+		select {
+		case <-t.engine.doneChan():
+			return
+		case <-t.engine.stopHelpers:
+			return
+		default:
+		}
+		var depth = int(atomic.LoadInt32(&t.engine.globalDepth)) + 1 +
+			threadIndex%2 + threadIndex/2
+		if depth > maxHeight {
+			return
+		}
+		shuffleMoveTies(ml, rnd)
+		t.searchRootHelper(ml, depth)
+	}
+}
+
+// searchRootHelper is searchRootMain for a helper thread: the result is
+// discarded, only the TT entries it leaves behind are useful.
+func (t *thread) searchRootHelper(ml []Move, depth int) {
 	const height = 0
-	var p = &mainThread.stack[height].position
+	var p = &t.stack[height].position
 	var alpha = -valueInfinity
 	const beta = valueInfinity
 	var bestMoveIndex = 0
-	{
-		var child = &mainThread.stack[height+1].position
-		var move = ml[0]
-		p.MakeMove(move, child)
-		var newDepth = mainThread.newDepth(depth, height)
-		var score = -mainThread.alphaBeta(-beta, -alpha, newDepth, height+1)
-		alpha = score
-		e.mainLine.update(depth, score,
-			append([]Move{move}, mainThread.stack[height+1].pv.moves()...))
-	}
-	var gate = &sync.Mutex{}
-	var index = 1
-	parallelDo(e.Threads.Value, func(threadIndex int) {
-		defer recoverFromSearchTimeout()
-		var t = &e.threads[threadIndex]
+	for i, move := range ml {
 		var child = &t.stack[height+1].position
-		for {
-			gate.Lock()
-			var localAlpha = alpha
-			var localIndex = index
-			index++
-			gate.Unlock()
-			if localIndex >= len(ml) {
-				return
-			}
-			var move = ml[localIndex]
-			p.MakeMove(move, child)
-			var newDepth = t.newDepth(depth, height)
-			if -t.alphaBeta(-(localAlpha+1), -localAlpha, newDepth, height+1) <= localAlpha {
-				continue
-			}
-			var score = -t.alphaBeta(-beta, -localAlpha, newDepth, height+1)
-			gate.Lock()
+		if !p.MakeMove(move, child) {
+			continue
+		}
+		var newDepth = t.newDepth(depth, height)
+		var score int
+		if i == 0 {
+			score = -t.alphaBeta(-beta, -alpha, newDepth, height+1)
+		} else {
+			score = -t.alphaBeta(-(alpha + 1), -alpha, newDepth, height+1)
 			if score > alpha {
-				alpha = score
-				e.mainLine.update(depth, score,
-					append([]Move{move}, t.stack[height+1].pv.moves()...))
-				bestMoveIndex = localIndex
+				score = -t.alphaBeta(-beta, -alpha, newDepth, height+1)
 			}
-			gate.Unlock()
 		}
-	})
+		if score > alpha {
+			alpha = score
+			bestMoveIndex = i
+		}
+	}
 	moveToBegin(ml, bestMoveIndex)
-	return alpha
+}
+
+// shuffleMoveTies randomizes every move but the first (the best move
+// found so far), so helper threads probe ordering ties differently.
+func shuffleMoveTies(ml []Move, rnd *rand.Rand) {
+	if len(ml) <= 2 {
+		return
+	}
+	rnd.Shuffle(len(ml)-1, func(i, j int) {
+		ml[i+1], ml[j+1] = ml[j+1], ml[i+1]
+	})
 }
 
 func (t *thread) alphaBeta(alpha, beta, depth, height int) int {
@@ -306,7 +451,8 @@ func (t *thread) quiescence(alpha, beta, depth, height int) int {
 
 func (t *thread) incNodes() {
 	t.nodes++
-	if (t.nodes&255) == 0 && isDone(t.engine.done) {
+	if (t.nodes&255) == 0 &&
+		(isDone(t.engine.doneChan()) || isDone(t.engine.stopHelpers)) {
 		panic(searchTimeout)
 	}
 }
@@ -423,3 +569,4 @@ func (e *Engine) genRootMoves() []Move {
 	}
 	return result
 }
+
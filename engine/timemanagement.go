@@ -2,59 +2,38 @@ package engine
 
 import (
 	"context"
-	"errors"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-var searchTimeout = errors.New("search timeout")
-
 type timeControlStrategy func(main, inc, moves int) (softLimit, hardLimit int)
 
+// timeManager tracks the soft/hard limits for one Search call. While
+// pondering it ignores both limits until PonderHit or Stop is called;
+// PonderHit resets the clock to now and engages the normal limits, Stop
+// cancels the search outright. Because PonderHit/Stop can be called from
+// the UCI goroutine while the search goroutine is reading start/done
+// concurrently, start, cancel and done are guarded by mu; ponder and
+// nodes are updated atomically, and parent and the limits are not
+// changed after NewTimeManager.
 type timeManager struct {
+	mu       sync.Mutex
+	parent   context.Context
 	start    time.Time
 	softTime time.Duration
+	hardTime time.Duration
+	ponder   int32 // atomic bool, also guarded by mu for the swap in PonderHit
 	nodes    int64
-	done     <-chan struct{}
 	cancel   context.CancelFunc
+	done     <-chan struct{}
 }
 
-func (tm *timeManager) Nodes() int64 {
-	return tm.nodes
-}
-
-func (tm *timeManager) IsHardTimeout() bool {
-	select {
-	case <-tm.done:
-		return true
-	default:
-		return false
-	}
-}
-
-func (tm *timeManager) IncNodes() {
-	var nodes = atomic.AddInt64(&tm.nodes, 1)
-	if (nodes&63) == 0 && tm.IsHardTimeout() {
-		panic(searchTimeout)
-	}
-}
-
-func (tm *timeManager) ElapsedMilliseconds() int64 {
-	return int64(time.Since(tm.start) / time.Millisecond)
-}
-
-func (tm *timeManager) IsSoftTimeout() bool {
-	return (tm.softTime > 0 && time.Since(tm.start) >= tm.softTime)
-}
-
-func (tm *timeManager) Close() {
-	if tm.cancel != nil {
-		tm.cancel()
-	}
-}
-
+// NewTimeManager computes the soft/hard limits for side from limits and
+// arms them immediately, unless ponder is true, in which case the clock
+// starts now but the limits are not armed until PonderHit.
 func NewTimeManager(limits LimitsType, timeControlStrategy timeControlStrategy,
-	side bool, ctx context.Context) *timeManager {
+	side, ponder bool, ctx context.Context) *timeManager {
 	var start = time.Now()
 
 	if timeControlStrategy == nil {
@@ -79,15 +58,118 @@ func NewTimeManager(limits LimitsType, timeControlStrategy timeControlStrategy,
 		softTime, hardTime = timeControlStrategy(main, increment, limits.MovesToGo)
 	}
 
-	var cancel context.CancelFunc
-	if hardTime > 0 {
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(hardTime)*time.Millisecond)
-	}
-	return &timeManager{
+	var tm = &timeManager{
+		parent:   ctx,
 		start:    start,
 		softTime: time.Duration(softTime) * time.Millisecond,
-		done:     ctx.Done(),
-		cancel:   cancel,
+		hardTime: time.Duration(hardTime) * time.Millisecond,
+	}
+	if ponder {
+		atomic.StoreInt32(&tm.ponder, 1)
+		tm.arm(ctx, false)
+	} else {
+		tm.arm(ctx, true)
+	}
+	return tm
+}
+
+// arm (re)derives tm.done/tm.cancel from parent, applying the hard time
+// limit only when withLimit is true. Callers must hold tm.mu.
+func (tm *timeManager) arm(parent context.Context, withLimit bool) {
+	var ctx = parent
+	var cancel context.CancelFunc
+	if withLimit && tm.hardTime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, tm.hardTime)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	tm.cancel = cancel
+	tm.done = ctx.Done()
+}
+
+// Done returns the channel the search should watch for a hard timeout
+// or cancellation. It changes after PonderHit, so callers
+// must re-read it rather than caching the value for the whole search.
+func (tm *timeManager) Done() <-chan struct{} {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.done
+}
+
+// PonderHit resets the clock to now and engages the normal soft/hard
+// limits. It is a no-op once the search is no longer pondering.
+func (tm *timeManager) PonderHit() {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if atomic.LoadInt32(&tm.ponder) == 0 {
+		return
+	}
+	atomic.StoreInt32(&tm.ponder, 0)
+	tm.start = time.Now()
+	var prevCancel = tm.cancel
+	tm.arm(tm.parent, true)
+	if prevCancel != nil {
+		prevCancel()
+	}
+}
+
+// Stop cancels the search immediately regardless of ponder state; the
+// search returns its current best line.
+func (tm *timeManager) Stop() {
+	tm.mu.Lock()
+	var cancel = tm.cancel
+	tm.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (tm *timeManager) IsPondering() bool {
+	return atomic.LoadInt32(&tm.ponder) != 0
+}
+
+func (tm *timeManager) Nodes() int64 {
+	return tm.nodes
+}
+
+func (tm *timeManager) IsHardTimeout() bool {
+	select {
+	case <-tm.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func (tm *timeManager) IncNodes() {
+	var nodes = atomic.AddInt64(&tm.nodes, 1)
+	if (nodes&63) == 0 && tm.IsHardTimeout() {
+		panic(searchTimeout)
+	}
+}
+
+func (tm *timeManager) ElapsedMilliseconds() int64 {
+	tm.mu.Lock()
+	var start = tm.start
+	tm.mu.Unlock()
+	return int64(time.Since(start) / time.Millisecond)
+}
+
+// IsSoftTimeout never reports a timeout while pondering, since the soft
+// limit only starts counting down once PonderHit engages it.
+func (tm *timeManager) IsSoftTimeout() bool {
+	if tm.IsPondering() {
+		return false
+	}
+	return tm.softTime > 0 && tm.ElapsedMilliseconds() >= int64(tm.softTime/time.Millisecond)
+}
+
+func (tm *timeManager) Close() {
+	tm.mu.Lock()
+	var cancel = tm.cancel
+	tm.mu.Unlock()
+	if cancel != nil {
+		cancel()
 	}
 }
 
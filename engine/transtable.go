@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"sync/atomic"
+
+	. "github.com/ChizhovVadim/CounterGo/common"
+)
+
+const ttBytesPerSlot = 16
+
+// ttSlot is one lockless transposition table slot, Hyatt's XOR-of-key-
+// and-data scheme: lock holds key^data rather than the raw key, so a
+// Read racing a concurrent Update on the same slot decodes a key that
+// almost certainly matches no real position (instead of pairing one
+// write's key with another write's data) and so reports a miss.
+type ttSlot struct {
+	lock atomic.Uint64
+	data atomic.Uint64
+}
+
+func packTTData(depth, score, bound int, move Move) uint64 {
+	return uint64(uint8(depth)) |
+		uint64(uint8(bound))<<8 |
+		uint64(uint16(score))<<16 |
+		uint64(uint32(move))<<32
+}
+
+func unpackTTData(data uint64) (depth, score, bound int, move Move) {
+	depth = int(uint8(data))
+	bound = int(uint8(data >> 8))
+	score = int(int16(uint16(data >> 16)))
+	move = Move(uint32(data >> 32))
+	return
+}
+
+// transTable is the TransTable shared by every Lazy-SMP thread. Read and
+// Update never block each other or themselves, trading an occasional
+// false miss on a torn slot for never serializing search threads on a
+// lock in the hottest part of alphaBeta.
+type transTable struct {
+	megabytes int
+	mask      uint64
+	slots     []ttSlot
+}
+
+func NewTransTable(megabytes int) *transTable {
+	var tt = &transTable{}
+	tt.resize(megabytes)
+	return tt
+}
+
+func (tt *transTable) resize(megabytes int) {
+	var size = megabytes * 1024 * 1024 / ttBytesPerSlot
+	var capacity = 1
+	for capacity*2 <= size {
+		capacity *= 2
+	}
+	tt.megabytes = megabytes
+	tt.mask = uint64(capacity - 1)
+	tt.slots = make([]ttSlot, capacity)
+}
+
+func (tt *transTable) Megabytes() int {
+	return tt.megabytes
+}
+
+func (tt *transTable) PrepareNewSearch() {
+}
+
+func (tt *transTable) Clear() {
+	tt.slots = make([]ttSlot, len(tt.slots))
+}
+
+func (tt *transTable) Read(p *Position) (depth, score, bound int, move Move, ok bool) {
+	var slot = &tt.slots[p.Key&tt.mask]
+	var data = slot.data.Load()
+	var lock = slot.lock.Load()
+	if lock^data != p.Key {
+		return 0, 0, 0, MoveEmpty, false
+	}
+	depth, score, bound, move = unpackTTData(data)
+	return depth, score, bound, move, true
+}
+
+func (tt *transTable) Update(p *Position, depth, score, bound int, move Move) {
+	var slot = &tt.slots[p.Key&tt.mask]
+	var data = packTTData(depth, score, bound, move)
+	slot.data.Store(data)
+	slot.lock.Store(p.Key ^ data)
+}
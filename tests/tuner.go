@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"math/rand"
 	"os"
 	"runtime"
 	"sync"
@@ -16,6 +17,8 @@ import (
 type TunableEvaluator interface {
 	Evaluate(p *common.Position) int
 	Apply(weights []int) []int
+	// Gradient returns the per-weight feature counts (df/dw_i) at p.
+	Gradient(p *common.Position) []float64
 }
 
 type Tuner struct {
@@ -23,6 +26,12 @@ type Tuner struct {
 	EvalBuilder func() TunableEvaluator
 	FilePath    string
 	Lambda      float64
+	Optimizer   string // "coord" (default, for existing callers) or "adam"
+	AdamLR      float64
+	AdamBeta1   float64
+	AdamBeta2   float64
+	AdamEpsilon float64
+	BatchSize   int
 	samples     []tuneEntry
 	threads     []tunerThread
 }
@@ -35,6 +44,7 @@ type tuneEntry struct {
 type tunerThread struct {
 	evaluator TunableEvaluator
 	sum       float64
+	gradient  []float64
 }
 
 func (t *Tuner) Run() error {
@@ -56,7 +66,12 @@ func (t *Tuner) Run() error {
 	var evalService = t.EvalBuilder()
 	var weights = evalService.Apply(nil)
 	t.Logger.Printf("Params count: %v", len(weights))
-	t.coordinateDescent(weights)
+
+	if t.Optimizer == "adam" {
+		t.adamOptimize(weights)
+	} else {
+		t.coordinateDescent(weights)
+	}
 
 	var er = t.computeError(weights)
 	fmt.Printf("// Error: %.6f\n", er)
@@ -175,6 +190,138 @@ func (t *Tuner) coordinateDescent(weights []int) {
 	}
 }
 
+// adamOptimize trains weights in place with mini-batch Adam.
+func (t *Tuner) adamOptimize(weights []int) {
+	const (
+		sigmoidK       = 135
+		defaultLR      = 1.0
+		defaultBeta1   = 0.9
+		defaultBeta2   = 0.999
+		defaultEpsilon = 1e-8
+		defaultBatch   = 16 * 1024
+	)
+
+	var lr = t.AdamLR
+	if lr == 0 {
+		lr = defaultLR
+	}
+	var beta1 = t.AdamBeta1
+	if beta1 == 0 {
+		beta1 = defaultBeta1
+	}
+	var beta2 = t.AdamBeta2
+	if beta2 == 0 {
+		beta2 = defaultBeta2
+	}
+	var epsilon = t.AdamEpsilon
+	if epsilon == 0 {
+		epsilon = defaultEpsilon
+	}
+	var batchSize = t.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatch
+	}
+
+	var m = make([]float64, len(weights))
+	var v = make([]float64, len(weights))
+
+	var order = make([]int, len(t.samples))
+	for i := range order {
+		order[i] = i
+	}
+
+	var bestE = t.computeError(weights)
+	var breakF = shouldBreak(3, 0.00004)
+
+	for epoch := 1; ; epoch++ {
+		if breakF(bestE) {
+			break
+		}
+
+		rand.Shuffle(len(order), func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+
+		for start := 0; start < len(order); start += batchSize {
+			var end = start + batchSize
+			if end > len(order) {
+				end = len(order)
+			}
+			var grad = t.computeGradient(weights, order[start:end], sigmoidK)
+			for i := range weights {
+				var g = grad[i] + t.Lambda*sign(weights[i])
+				m[i] = beta1*m[i] + (1-beta1)*g
+				v[i] = beta2*v[i] + (1-beta2)*g*g
+				var delta = lr * m[i] / (math.Sqrt(v[i]) + epsilon)
+				weights[i] -= int(math.Round(delta))
+			}
+		}
+
+		bestE = t.computeError(weights)
+		t.Logger.Printf("Epoch: %v Error: %.6f", epoch, bestE)
+	}
+}
+
+// computeGradient returns the mean loss gradient over batch.
+func (t *Tuner) computeGradient(weights []int, batch []int, sigmoidK float64) []float64 {
+	var wg = &sync.WaitGroup{}
+	var index = int32(-1)
+	for i := range t.threads {
+		wg.Add(1)
+		go func(thread *tunerThread) {
+			if len(thread.gradient) != len(weights) {
+				thread.gradient = make([]float64, len(weights))
+			}
+			for i := range thread.gradient {
+				thread.gradient[i] = 0
+			}
+			thread.evaluator.Apply(weights)
+			for {
+				var i = int(atomic.AddInt32(&index, 1))
+				if i >= len(batch) {
+					break
+				}
+				var entry = &t.samples[batch[i]]
+				var sign = 1.0
+				if !entry.position.WhiteMove {
+					sign = -1.0
+				}
+				var eval = sign * float64(thread.evaluator.Evaluate(&entry.position))
+				var sigma = 1.0 / (1.0 + math.Exp(-eval/sigmoidK))
+				var dLossDEval = -2 * (entry.score - sigma) * sigma * (1 - sigma) / sigmoidK
+				var counts = thread.evaluator.Gradient(&entry.position)
+				for j, c := range counts {
+					thread.gradient[j] += sign * dLossDEval * c
+				}
+			}
+			wg.Done()
+		}(&t.threads[i])
+	}
+	wg.Wait()
+
+	var result = make([]float64, len(weights))
+	for i := range t.threads {
+		for j, g := range t.threads[i].gradient {
+			result[j] += g
+		}
+	}
+	for j := range result {
+		result[j] /= float64(len(batch))
+	}
+	return result
+}
+
+func sign(w int) float64 {
+	switch {
+	case w > 0:
+		return 1
+	case w < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
 func sigmoid(s float64) float64 {
 	return 1.0 / (1.0 + math.Exp(-s/135))
 }